@@ -0,0 +1,99 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WithDeadline attaches a context.WithDeadline to the request bounded by d,
+// unless the client overrides it via the X-Request-Timeout header or an
+// OpenAI-style "timeout" request body field. Downstream middlewares and
+// handlers are expected to propagate c.Request.Context() into their calls
+// against Ollama so that a timeout or client disconnect aborts the upstream
+// request rather than leaving it running. If the deadline expires before
+// anything has been written to the client, the response is converted into
+// OpenAI's standard request_timeout error envelope; if a chat completion was
+// already streaming, a final "data: [DONE]" is flushed instead so the client
+// doesn't see a truncated SSE frame.
+func WithDeadline(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := requestTimeout(c, d)
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if ctx.Err() != context.DeadlineExceeded {
+			return
+		}
+
+		if cw, ok := c.Writer.(*ChatWriter); ok {
+			cw.ResponseWriter.Write([]byte("data: [DONE]\n\n"))
+			return
+		}
+
+		if !c.Writer.Written() {
+			c.AbortWithStatusJSON(http.StatusRequestTimeout, timeoutError())
+		}
+	}
+}
+
+func timeoutError() ErrorResponse {
+	code := "request_timeout"
+	return ErrorResponse{Error{
+		Message: "Request timed out.",
+		Type:    "timeout",
+		Code:    &code,
+	}}
+}
+
+// requestTimeout resolves the effective per-request timeout: the
+// X-Request-Timeout header takes priority, then a "timeout" field in the
+// JSON body (read non-destructively), falling back to d.
+func requestTimeout(c *gin.Context, d time.Duration) time.Duration {
+	if h := c.GetHeader("X-Request-Timeout"); h != "" {
+		if secs, err := strconv.ParseFloat(h, 64); err == nil && secs > 0 {
+			return time.Duration(secs * float64(time.Second))
+		}
+	}
+
+	if secs, ok := peekTimeoutField(c); ok && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+
+	return d
+}
+
+func peekTimeoutField(c *gin.Context) (float64, bool) {
+	if c.Request.Body == nil {
+		return 0, false
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return 0, false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var payload struct {
+		Timeout *float64 `json:"timeout"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Timeout == nil {
+		return 0, false
+	}
+
+	return *payload.Timeout, true
+}
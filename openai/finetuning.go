@@ -0,0 +1,307 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+// FineTuningHyperparameters mirrors OpenAI's hyperparameters object. Each
+// field accepts either a concrete number or the string "auto", so they are
+// typed as any and passed through to the Modelfile as PARAMETER directives.
+type FineTuningHyperparameters struct {
+	NEpochs                any `json:"n_epochs,omitempty"`
+	BatchSize              any `json:"batch_size,omitempty"`
+	LearningRateMultiplier any `json:"learning_rate_multiplier,omitempty"`
+}
+
+type FineTuningJob struct {
+	Id              string                    `json:"id"`
+	Object          string                    `json:"object"`
+	Model           string                    `json:"model"`
+	CreatedAt       int64                     `json:"created_at"`
+	FinishedAt      *int64                    `json:"finished_at"`
+	FineTunedModel  *string                   `json:"fine_tuned_model"`
+	Status          string                    `json:"status"`
+	TrainingFile    string                    `json:"training_file"`
+	ValidationFile  *string                   `json:"validation_file"`
+	Hyperparameters FineTuningHyperparameters `json:"hyperparameters"`
+	ResultFiles     []string                  `json:"result_files"`
+	TrainedTokens   *int                      `json:"trained_tokens"`
+	Error           *Error                    `json:"error"`
+}
+
+type FineTuningJobEvent struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	CreatedAt int64  `json:"created_at"`
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+}
+
+type FineTuningJobList struct {
+	Object  string          `json:"object"`
+	Data    []FineTuningJob `json:"data"`
+	HasMore bool            `json:"has_more"`
+}
+
+type FineTuningJobEventList struct {
+	Object  string               `json:"object"`
+	Data    []FineTuningJobEvent `json:"data"`
+	HasMore bool                 `json:"has_more"`
+}
+
+type FineTuningJobRequest struct {
+	Model           string                     `json:"model"`
+	TrainingFile    string                     `json:"training_file"`
+	ValidationFile  *string                    `json:"validation_file"`
+	Hyperparameters *FineTuningHyperparameters `json:"hyperparameters"`
+	Suffix          *string                    `json:"suffix"`
+}
+
+// fineTuningJobs is an in-memory registry of jobs created through this
+// middleware. Ollama has no native concept of a fine-tuning job: each job
+// wraps a single /api/create call (adapter training against TrainingFile)
+// and the registry exists so list/retrieve/events can be served without a
+// second round-trip to the server.
+var fineTuningJobs = struct {
+	sync.Mutex
+	jobs   map[string]*FineTuningJob
+	events map[string][]FineTuningJobEvent
+	order  []string
+}{
+	jobs:   make(map[string]*FineTuningJob),
+	events: make(map[string][]FineTuningJobEvent),
+}
+
+func newFineTuningJobID() string {
+	return fmt.Sprintf("ftjob-%d", rand.Int63())
+}
+
+func fromFineTuningJobRequest(id string, r FineTuningJobRequest) api.CreateRequest {
+	suffix := id
+	if r.Suffix != nil && *r.Suffix != "" {
+		suffix = *r.Suffix
+	}
+
+	modelfile := fmt.Sprintf("FROM %s\nADAPTER %s\n", r.Model, r.TrainingFile)
+	if r.Hyperparameters != nil {
+		if r.Hyperparameters.LearningRateMultiplier != nil {
+			modelfile += fmt.Sprintf("PARAMETER learning_rate_multiplier %v\n", r.Hyperparameters.LearningRateMultiplier)
+		}
+
+		if r.Hyperparameters.NEpochs != nil {
+			modelfile += fmt.Sprintf("PARAMETER num_epochs %v\n", r.Hyperparameters.NEpochs)
+		}
+
+		if r.Hyperparameters.BatchSize != nil {
+			modelfile += fmt.Sprintf("PARAMETER batch_size %v\n", r.Hyperparameters.BatchSize)
+		}
+	}
+
+	stream := true
+	return api.CreateRequest{
+		Model:     fmt.Sprintf("%s:%s", r.Model, suffix),
+		Modelfile: modelfile,
+		Stream:    &stream,
+	}
+}
+
+func toFineTuningJob(id string, r FineTuningJobRequest) FineTuningJob {
+	hp := FineTuningHyperparameters{
+		NEpochs:                "auto",
+		BatchSize:              "auto",
+		LearningRateMultiplier: "auto",
+	}
+	if r.Hyperparameters != nil {
+		hp = *r.Hyperparameters
+	}
+
+	return FineTuningJob{
+		Id:              id,
+		Object:          "fine_tuning.job",
+		Model:           r.Model,
+		CreatedAt:       time.Now().Unix(),
+		Status:          "running",
+		TrainingFile:    r.TrainingFile,
+		ValidationFile:  r.ValidationFile,
+		Hyperparameters: hp,
+		ResultFiles:     []string{},
+	}
+}
+
+// recordFineTuningEventLocked appends an event assuming fineTuningJobs is
+// already locked by the caller.
+func recordFineTuningEventLocked(id, level, message string) {
+	fineTuningJobs.events[id] = append(fineTuningJobs.events[id], FineTuningJobEvent{
+		Id:        fmt.Sprintf("ftevent-%d", rand.Int63()),
+		Object:    "fine_tuning.job.event",
+		CreatedAt: time.Now().Unix(),
+		Level:     level,
+		Message:   message,
+	})
+}
+
+func recordFineTuningEvent(id, level, message string) {
+	fineTuningJobs.Lock()
+	defer fineTuningJobs.Unlock()
+	recordFineTuningEventLocked(id, level, message)
+}
+
+// CreateFineTuningJobMiddleware translates a POST /v1/fine_tuning/jobs
+// request into an Ollama model create (LoRA adapter) call. The upstream
+// /api/create progress stream is consumed synchronously and recorded as
+// fine-tuning job events so GET .../events can replay it afterwards.
+func CreateFineTuningJobMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req FineTuningJobRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		if req.Model == "" || req.TrainingFile == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, "'model' and 'training_file' are required"))
+			return
+		}
+
+		id := newFineTuningJobID()
+		job := toFineTuningJob(id, req)
+
+		fineTuningJobs.Lock()
+		fineTuningJobs.jobs[id] = &job
+		fineTuningJobs.order = append(fineTuningJobs.order, id)
+		fineTuningJobs.Unlock()
+
+		recordFineTuningEvent(id, "info", "Created fine-tuning job "+id)
+
+		createReq := fromFineTuningJobRequest(id, req)
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(createReq); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		c.Request.Body = io.NopCloser(&b)
+
+		w := &BodyWriter{ResponseWriter: c.Writer, b: new(bytes.Buffer)}
+		c.Writer = w
+
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		fineTuningJobs.Lock()
+		defer fineTuningJobs.Unlock()
+
+		if w.Status() != http.StatusOK {
+			job.Status = "failed"
+			job.Error = &Error{Message: "model create failed", Type: "server_error"}
+			recordFineTuningEventLocked(id, "error", "Fine-tuning job failed")
+			c.JSON(http.StatusOK, *fineTuningJobs.jobs[id])
+			return
+		}
+
+		for _, line := range bytes.Split(w.b.Bytes(), []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+
+			var progress api.ProgressResponse
+			if err := json.Unmarshal(line, &progress); err == nil && progress.Status != "" {
+				recordFineTuningEventLocked(id, "info", progress.Status)
+			}
+		}
+
+		finishedAt := time.Now().Unix()
+		fineTunedModel := createReq.Model
+		job.Status = "succeeded"
+		job.FinishedAt = &finishedAt
+		job.FineTunedModel = &fineTunedModel
+		recordFineTuningEventLocked(id, "info", "Fine-tuning job successfully completed")
+
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+func ListFineTuningJobsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fineTuningJobs.Lock()
+		defer fineTuningJobs.Unlock()
+
+		data := []FineTuningJob{}
+		for i := len(fineTuningJobs.order) - 1; i >= 0; i-- {
+			data = append(data, *fineTuningJobs.jobs[fineTuningJobs.order[i]])
+		}
+
+		c.JSON(http.StatusOK, FineTuningJobList{
+			Object: "list",
+			Data:   data,
+		})
+	}
+}
+
+func RetrieveFineTuningJobMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fineTuningJobs.Lock()
+		job, ok := fineTuningJobs.jobs[c.Param("id")]
+		fineTuningJobs.Unlock()
+
+		if !ok {
+			c.JSON(http.StatusNotFound, NewError(http.StatusNotFound, "no such fine-tuning job: "+c.Param("id")))
+			return
+		}
+
+		c.JSON(http.StatusOK, *job)
+	}
+}
+
+func CancelFineTuningJobMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fineTuningJobs.Lock()
+		defer fineTuningJobs.Unlock()
+
+		job, ok := fineTuningJobs.jobs[c.Param("id")]
+		if !ok {
+			c.JSON(http.StatusNotFound, NewError(http.StatusNotFound, "no such fine-tuning job: "+c.Param("id")))
+			return
+		}
+
+		if job.Status == "running" {
+			job.Status = "cancelled"
+			recordFineTuningEventLocked(job.Id, "info", "Fine-tuning job cancelled")
+		}
+
+		c.JSON(http.StatusOK, *job)
+	}
+}
+
+func ListFineTuningJobEventsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fineTuningJobs.Lock()
+		defer fineTuningJobs.Unlock()
+
+		if _, ok := fineTuningJobs.jobs[c.Param("id")]; !ok {
+			c.JSON(http.StatusNotFound, NewError(http.StatusNotFound, "no such fine-tuning job: "+c.Param("id")))
+			return
+		}
+
+		events := fineTuningJobs.events[c.Param("id")]
+		if events == nil {
+			events = []FineTuningJobEvent{}
+		}
+
+		c.JSON(http.StatusOK, FineTuningJobEventList{
+			Object: "list",
+			Data:   events,
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+// moderationSystemPrompt forces the classifier model to emit a JSON array,
+// one object per input in order, scoring the fixed OpenAI moderation
+// category set between 0 and 1.
+const moderationSystemPrompt = `You are a content moderation classifier. You will be given a JSON array of strings to classify.
+Respond with only a JSON array of the same length, in the same order, with one object per input string.
+Each object must have exactly these fields, each a number between 0 and 1 representing the likelihood the input belongs to that category:
+"hate", "hate/threatening", "harassment", "harassment/threatening", "self-harm", "self-harm/intent", "self-harm/instructions", "sexual", "sexual/minors", "violence", "violence/graphic".
+Do not include any explanation or text other than the JSON array.`
+
+const moderationThreshold = 0.5
+
+type ModerationRequest struct {
+	Input any    `json:"input"`
+	Model string `json:"model"`
+}
+
+type ModerationCategories struct {
+	Hate                  bool `json:"hate"`
+	HateThreatening       bool `json:"hate/threatening"`
+	Harassment            bool `json:"harassment"`
+	HarassmentThreatening bool `json:"harassment/threatening"`
+	SelfHarm              bool `json:"self-harm"`
+	SelfHarmIntent        bool `json:"self-harm/intent"`
+	SelfHarmInstructions  bool `json:"self-harm/instructions"`
+	Sexual                bool `json:"sexual"`
+	SexualMinors          bool `json:"sexual/minors"`
+	Violence              bool `json:"violence"`
+	ViolenceGraphic       bool `json:"violence/graphic"`
+}
+
+type ModerationCategoryScores struct {
+	Hate                  float64 `json:"hate"`
+	HateThreatening       float64 `json:"hate/threatening"`
+	Harassment            float64 `json:"harassment"`
+	HarassmentThreatening float64 `json:"harassment/threatening"`
+	SelfHarm              float64 `json:"self-harm"`
+	SelfHarmIntent        float64 `json:"self-harm/intent"`
+	SelfHarmInstructions  float64 `json:"self-harm/instructions"`
+	Sexual                float64 `json:"sexual"`
+	SexualMinors          float64 `json:"sexual/minors"`
+	Violence              float64 `json:"violence"`
+	ViolenceGraphic       float64 `json:"violence/graphic"`
+}
+
+type ModerationResult struct {
+	Flagged        bool                     `json:"flagged"`
+	Categories     ModerationCategories     `json:"categories"`
+	CategoryScores ModerationCategoryScores `json:"category_scores"`
+}
+
+type Moderation struct {
+	Id      string             `json:"id"`
+	Model   string             `json:"model"`
+	Results []ModerationResult `json:"results"`
+}
+
+// moderationClassification is the shape the classifier model is instructed
+// to produce for a single input; it is not exposed to API clients directly.
+type moderationClassification struct {
+	Hate                  float64 `json:"hate"`
+	HateThreatening       float64 `json:"hate/threatening"`
+	Harassment            float64 `json:"harassment"`
+	HarassmentThreatening float64 `json:"harassment/threatening"`
+	SelfHarm              float64 `json:"self-harm"`
+	SelfHarmIntent        float64 `json:"self-harm/intent"`
+	SelfHarmInstructions  float64 `json:"self-harm/instructions"`
+	Sexual                float64 `json:"sexual"`
+	SexualMinors          float64 `json:"sexual/minors"`
+	Violence              float64 `json:"violence"`
+	ViolenceGraphic       float64 `json:"violence/graphic"`
+}
+
+func toModerationResult(c moderationClassification) ModerationResult {
+	categories := ModerationCategories{
+		Hate:                  c.Hate >= moderationThreshold,
+		HateThreatening:       c.HateThreatening >= moderationThreshold,
+		Harassment:            c.Harassment >= moderationThreshold,
+		HarassmentThreatening: c.HarassmentThreatening >= moderationThreshold,
+		SelfHarm:              c.SelfHarm >= moderationThreshold,
+		SelfHarmIntent:        c.SelfHarmIntent >= moderationThreshold,
+		SelfHarmInstructions:  c.SelfHarmInstructions >= moderationThreshold,
+		Sexual:                c.Sexual >= moderationThreshold,
+		SexualMinors:          c.SexualMinors >= moderationThreshold,
+		Violence:              c.Violence >= moderationThreshold,
+		ViolenceGraphic:       c.ViolenceGraphic >= moderationThreshold,
+	}
+
+	flagged := categories.Hate || categories.HateThreatening || categories.Harassment ||
+		categories.HarassmentThreatening || categories.SelfHarm || categories.SelfHarmIntent ||
+		categories.SelfHarmInstructions || categories.Sexual || categories.SexualMinors ||
+		categories.Violence || categories.ViolenceGraphic
+
+	return ModerationResult{
+		Flagged:    flagged,
+		Categories: categories,
+		CategoryScores: ModerationCategoryScores{
+			Hate:                  c.Hate,
+			HateThreatening:       c.HateThreatening,
+			Harassment:            c.Harassment,
+			HarassmentThreatening: c.HarassmentThreatening,
+			SelfHarm:              c.SelfHarm,
+			SelfHarmIntent:        c.SelfHarmIntent,
+			SelfHarmInstructions:  c.SelfHarmInstructions,
+			Sexual:                c.Sexual,
+			SexualMinors:          c.SexualMinors,
+			Violence:              c.Violence,
+			ViolenceGraphic:       c.ViolenceGraphic,
+		},
+	}
+}
+
+func moderationInputs(input any) ([]string, bool) {
+	switch v := input.(type) {
+	case string:
+		return []string{v}, true
+	case []any:
+		inputs := make([]string, len(v))
+		for i, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, false
+			}
+			inputs[i] = s
+		}
+		return inputs, true
+	default:
+		return nil, false
+	}
+}
+
+// ModerationMiddleware dispatches moderation requests to a configurable
+// Ollama classifier model over /api/generate, forcing structured JSON
+// output over the fixed OpenAI moderation category set.
+func ModerationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ModerationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		inputs, ok := moderationInputs(req.Input)
+		if !ok || len(inputs) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, "'input' must be a string or an array of strings"))
+			return
+		}
+
+		prompt, err := json.Marshal(inputs)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		stream := false
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(api.GenerateRequest{
+			Model:  req.Model,
+			System: moderationSystemPrompt,
+			Prompt: string(prompt),
+			Format: json.RawMessage(`"json"`),
+			Stream: &stream,
+		}); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		c.Request.Body = io.NopCloser(&b)
+
+		w := &BodyWriter{ResponseWriter: c.Writer, b: new(bytes.Buffer)}
+		c.Writer = w
+
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.Status() != http.StatusOK {
+			return
+		}
+
+		var genResponse api.GenerateResponse
+		if err := json.Unmarshal(w.b.Bytes(), &genResponse); err != nil {
+			c.JSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		var classifications []moderationClassification
+		if err := json.Unmarshal([]byte(genResponse.Response), &classifications); err != nil || len(classifications) != len(inputs) {
+			// The classifier model didn't return valid, length-matched JSON.
+			// Fall back to reporting every input as unflagged rather than
+			// failing the request outright.
+			classifications = make([]moderationClassification, len(inputs))
+		}
+
+		results := make([]ModerationResult, len(inputs))
+		for i, cl := range classifications {
+			results[i] = toModerationResult(cl)
+		}
+
+		c.JSON(http.StatusOK, Moderation{
+			Id:      fmt.Sprintf("modr-%d", rand.Int63()),
+			Model:   req.Model,
+			Results: results,
+		})
+	}
+}
@@ -0,0 +1,699 @@
+// Package openai provides middleware for partial compatibility with the OpenAI REST API
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+type Error struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   any     `json:"param"`
+	Code    *string `json:"code"`
+}
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type Choice struct {
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+type ChunkChoice struct {
+	Index        int     `json:"index"`
+	Delta        Message `json:"delta"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type ChatCompletion struct {
+	Id                string   `json:"id"`
+	Object            string   `json:"object"`
+	Created           int64    `json:"created"`
+	Model             string   `json:"model"`
+	SystemFingerprint string   `json:"system_fingerprint"`
+	Choices           []Choice `json:"choices"`
+	Usage             Usage    `json:"usage,omitempty"`
+}
+
+type ChatCompletionChunk struct {
+	Id                string        `json:"id"`
+	Object            string        `json:"object"`
+	Created           int64         `json:"created"`
+	Model             string        `json:"model"`
+	SystemFingerprint string        `json:"system_fingerprint"`
+	Choices           []ChunkChoice `json:"choices"`
+	Usage             *Usage        `json:"usage,omitempty"`
+}
+
+type Model struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type ListCompletion struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
+type Embedding struct {
+	Object    string    `json:"object"`
+	Embedding []float64 `json:"embedding"`
+	Index     int       `json:"index"`
+}
+
+type EmbeddingList struct {
+	Object string      `json:"object"`
+	Data   []Embedding `json:"data"`
+	Model  string      `json:"model"`
+	Usage  Usage       `json:"usage,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// JSONSchema describes the `json_schema` variant of response_format: a
+// named schema the model's output must conform to.
+type JSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict"`
+}
+
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+type ChatCompletionRequest struct {
+	Model            string          `json:"model"`
+	Messages         []Message       `json:"messages"`
+	Stream           bool            `json:"stream"`
+	StreamOptions    *StreamOptions  `json:"stream_options"`
+	ResponseFormat   *ResponseFormat `json:"response_format"`
+	MaxTokens        *int            `json:"max_tokens"`
+	Seed             *int            `json:"seed"`
+	Stop             any             `json:"stop"`
+	Temperature      *float64        `json:"temperature"`
+	FrequencyPenalty *float64        `json:"frequency_penalty"`
+	PresencePenalty  *float64        `json:"presence_penalty"`
+	TopP             *float64        `json:"top_p"`
+}
+
+type EmbeddingRequest struct {
+	Input any    `json:"input"`
+	Model string `json:"model"`
+}
+
+func NewError(code int, message string) ErrorResponse {
+	var etype string
+	switch code {
+	case http.StatusBadRequest:
+		etype = "invalid_request_error"
+	case http.StatusNotFound:
+		etype = "not_found_error"
+	default:
+		etype = "api_error"
+	}
+
+	return ErrorResponse{Error{Type: etype, Message: message}}
+}
+
+func toChatCompletion(id string, r api.ChatResponse) ChatCompletion {
+	var finishReason *string
+	if r.Done {
+		reason := r.DoneReason
+		if reason == "" {
+			reason = "stop"
+		}
+		finishReason = &reason
+	}
+
+	return ChatCompletion{
+		Id:                id,
+		Object:            "chat.completion",
+		Created:           time.Now().Unix(),
+		Model:             r.Model,
+		SystemFingerprint: "fp_ollama",
+		Choices: []Choice{{
+			Index:        0,
+			Message:      Message{Role: r.Message.Role, Content: r.Message.Content},
+			FinishReason: finishReason,
+		}},
+		Usage: Usage{
+			PromptTokens:     r.PromptEvalCount,
+			CompletionTokens: r.EvalCount,
+			TotalTokens:      r.PromptEvalCount + r.EvalCount,
+		},
+	}
+}
+
+func toChunk(id string, r api.ChatResponse) ChatCompletionChunk {
+	var finishReason *string
+	if r.Done {
+		reason := r.DoneReason
+		if reason == "" {
+			reason = "stop"
+		}
+		finishReason = &reason
+	}
+
+	return ChatCompletionChunk{
+		Id:                id,
+		Object:            "chat.completion.chunk",
+		Created:           time.Now().Unix(),
+		Model:             r.Model,
+		SystemFingerprint: "fp_ollama",
+		Choices: []ChunkChoice{{
+			Index:        0,
+			Delta:        Message{Role: r.Message.Role, Content: r.Message.Content},
+			FinishReason: finishReason,
+		}},
+	}
+}
+
+func toUsageChunk(id string, r api.ChatResponse) ChatCompletionChunk {
+	return ChatCompletionChunk{
+		Id:                id,
+		Object:            "chat.completion.chunk",
+		Created:           time.Now().Unix(),
+		Model:             r.Model,
+		SystemFingerprint: "fp_ollama",
+		Choices:           []ChunkChoice{},
+		Usage: &Usage{
+			PromptTokens:     r.PromptEvalCount,
+			CompletionTokens: r.EvalCount,
+			TotalTokens:      r.PromptEvalCount + r.EvalCount,
+		},
+	}
+}
+
+func toListCompletion(r api.ListResponse) ListCompletion {
+	var data []Model
+	for _, m := range r.Models {
+		data = append(data, Model{
+			Id:      m.Name,
+			Object:  "model",
+			Created: m.ModifiedAt.Unix(),
+			OwnedBy: "library",
+		})
+	}
+
+	return ListCompletion{
+		Object: "list",
+		Data:   data,
+	}
+}
+
+func toEmbeddingList(model string, r api.EmbeddingResponse) EmbeddingList {
+	if r.EmbeddingBatch != nil {
+		var data []Embedding
+		for i, e := range r.EmbeddingBatch {
+			data = append(data, Embedding{
+				Object:    "embedding",
+				Embedding: e,
+				Index:     i,
+			})
+		}
+
+		return EmbeddingList{
+			Object: "list",
+			Data:   data,
+			Model:  model,
+		}
+	}
+
+	return EmbeddingList{
+		Object: "list",
+		Data: []Embedding{{
+			Object:    "embedding",
+			Embedding: r.Embedding,
+			Index:     0,
+		}},
+		Model: model,
+	}
+}
+
+func toModel(r api.ShowResponse, id string) Model {
+	return Model{
+		Id:      id,
+		Object:  "model",
+		Created: r.ModifiedAt.Unix(),
+		OwnedBy: "library",
+	}
+}
+
+func fromChatRequest(r ChatCompletionRequest) api.ChatRequest {
+	var messages []api.Message
+	for _, m := range r.Messages {
+		messages = append(messages, api.Message{Role: m.Role, Content: m.Content})
+	}
+
+	options := make(map[string]any)
+	if r.Temperature != nil {
+		options["temperature"] = *r.Temperature
+	}
+
+	if r.TopP != nil {
+		options["top_p"] = *r.TopP
+	}
+
+	if r.FrequencyPenalty != nil {
+		options["frequency_penalty"] = *r.FrequencyPenalty
+	}
+
+	if r.PresencePenalty != nil {
+		options["presence_penalty"] = *r.PresencePenalty
+	}
+
+	if r.Seed != nil {
+		options["seed"] = *r.Seed
+	}
+
+	if r.MaxTokens != nil {
+		options["num_predict"] = *r.MaxTokens
+	}
+
+	var format json.RawMessage
+	if r.ResponseFormat != nil {
+		switch r.ResponseFormat.Type {
+		case "json_object":
+			format = json.RawMessage(`"json"`)
+		case "json_schema":
+			if r.ResponseFormat.JSONSchema != nil {
+				format = r.ResponseFormat.JSONSchema.Schema
+			}
+		}
+	}
+
+	return api.ChatRequest{
+		Model:    r.Model,
+		Messages: messages,
+		Stream:   &r.Stream,
+		Format:   format,
+		Options:  options,
+	}
+}
+
+// strictJSONSchema returns the schema the model's output must conform to
+// when response_format is {"type":"json_schema", "json_schema":{"strict":true,...}},
+// or nil otherwise.
+func strictJSONSchema(r ChatCompletionRequest) json.RawMessage {
+	if r.ResponseFormat == nil || r.ResponseFormat.Type != "json_schema" || r.ResponseFormat.JSONSchema == nil {
+		return nil
+	}
+
+	if !r.ResponseFormat.JSONSchema.Strict {
+		return nil
+	}
+
+	return r.ResponseFormat.JSONSchema.Schema
+}
+
+// validateJSONSchema checks content against a (possibly partial) JSON
+// Schema document, supporting the subset commonly used for structured chat
+// output: object/string/number/integer/boolean/array types, "properties",
+// and "required".
+func validateJSONSchema(schema json.RawMessage, content string) bool {
+	var doc any
+	if err := json.Unmarshal([]byte(content), &doc); err != nil {
+		return false
+	}
+
+	var spec struct {
+		Type       string                     `json:"type"`
+		Properties map[string]json.RawMessage `json:"properties"`
+		Required   []string                   `json:"required"`
+	}
+	if err := json.Unmarshal(schema, &spec); err != nil {
+		return true
+	}
+
+	if spec.Type != "object" {
+		return matchesJSONType(spec.Type, doc)
+	}
+
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return false
+	}
+
+	for _, name := range spec.Required {
+		if _, ok := obj[name]; !ok {
+			return false
+		}
+	}
+
+	for name, propSchema := range spec.Properties {
+		val, ok := obj[name]
+		if !ok {
+			continue
+		}
+
+		var prop struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(propSchema, &prop); err != nil {
+			continue
+		}
+
+		if !matchesJSONType(prop.Type, val) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchesJSONType(t string, v any) bool {
+	switch t {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == float64(int64(f))
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	default:
+		return true
+	}
+}
+
+// BodyWriter buffers the downstream Ollama response so middleware can
+// translate it into the equivalent OpenAI response shape before it is
+// written to the client.
+type BodyWriter struct {
+	gin.ResponseWriter
+	b *bytes.Buffer
+}
+
+func (w *BodyWriter) Write(b []byte) (int, error) {
+	return w.b.Write(b)
+}
+
+// ChatWriter rewrites the upstream /api/chat NDJSON stream into
+// OpenAI-compatible server-sent events as each line arrives, rather than
+// buffering the full response like BodyWriter does for non-streaming
+// requests.
+type ChatWriter struct {
+	gin.ResponseWriter
+	id           string
+	includeUsage bool
+	buf          bytes.Buffer
+}
+
+func (w *ChatWriter) writeChunk(chunk ChatCompletionChunk) error {
+	d, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.ResponseWriter.Write([]byte("data: ")); err != nil {
+		return err
+	}
+	if _, err := w.ResponseWriter.Write(d); err != nil {
+		return err
+	}
+	_, err = w.ResponseWriter.Write([]byte("\n\n"))
+	return err
+}
+
+func (w *ChatWriter) Write(data []byte) (int, error) {
+	w.ResponseWriter.Header().Set("Content-Type", "text/event-stream")
+	w.buf.Write(data)
+
+	for {
+		line, err := w.buf.ReadBytes('\n')
+		if err == io.EOF {
+			w.buf.Reset()
+			w.buf.Write(line)
+			break
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var chatResponse api.ChatResponse
+		if err := json.Unmarshal(line, &chatResponse); err != nil {
+			continue
+		}
+
+		if err := w.writeChunk(toChunk(w.id, chatResponse)); err != nil {
+			return 0, err
+		}
+
+		if chatResponse.Done {
+			if w.includeUsage {
+				if err := w.writeChunk(toUsageChunk(w.id, chatResponse)); err != nil {
+					return 0, err
+				}
+			}
+
+			if _, err := w.ResponseWriter.Write([]byte("data: [DONE]\n\n")); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(data), nil
+}
+
+func ListMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		w := &BodyWriter{ResponseWriter: c.Writer, b: new(bytes.Buffer)}
+		c.Writer = w
+
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.Status() != http.StatusOK {
+			return
+		}
+
+		var listResponse api.ListResponse
+		if err := json.Unmarshal(w.b.Bytes(), &listResponse); err != nil {
+			c.JSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, toListCompletion(listResponse))
+	}
+}
+
+func RetrieveMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(api.ShowRequest{Model: c.Param("model")}); err != nil {
+			c.JSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		c.Request.Body = io.NopCloser(&b)
+
+		w := &BodyWriter{ResponseWriter: c.Writer, b: new(bytes.Buffer)}
+		c.Writer = w
+
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.Status() != http.StatusOK {
+			return
+		}
+
+		var showResponse api.ShowResponse
+		if err := json.Unmarshal(w.b.Bytes(), &showResponse); err != nil {
+			c.JSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, toModel(showResponse, c.Param("model")))
+	}
+}
+
+func EmbeddingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req EmbeddingRequest
+		err := c.ShouldBindJSON(&req)
+		switch {
+		case errors.Is(err, io.EOF):
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, "missing request body"))
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		if req.Input == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, "invalid input"))
+			return
+		}
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(api.EmbeddingRequest{Model: req.Model, Prompt: fmt.Sprintf("%v", req.Input)}); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		c.Request.Body = io.NopCloser(&b)
+
+		w := &BodyWriter{ResponseWriter: c.Writer, b: new(bytes.Buffer)}
+		c.Writer = w
+
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.Status() != http.StatusOK {
+			return
+		}
+
+		var embeddingResponse api.EmbeddingResponse
+		if err := json.Unmarshal(w.b.Bytes(), &embeddingResponse); err != nil {
+			c.JSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, toEmbeddingList(req.Model, embeddingResponse))
+	}
+}
+
+func ChatMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ChatCompletionRequest
+		err := c.ShouldBindJSON(&req)
+		switch {
+		case errors.Is(err, io.EOF):
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, "missing request body"))
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		if len(req.Messages) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, "[] is too short - 'messages'"))
+			return
+		}
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(fromChatRequest(req)); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		c.Request.Body = io.NopCloser(&b)
+
+		id := fmt.Sprintf("chatcmpl-%d", rand.Int63())
+
+		if req.Stream {
+			includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+
+			c.Header("Content-Type", "text/event-stream")
+			c.Header("Cache-Control", "no-cache")
+			c.Header("Connection", "keep-alive")
+
+			w := &ChatWriter{ResponseWriter: c.Writer, id: id, includeUsage: includeUsage}
+			c.Writer = w
+
+			c.Next()
+			return
+		}
+
+		w := &BodyWriter{ResponseWriter: c.Writer, b: new(bytes.Buffer)}
+		c.Writer = w
+
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.Status() != http.StatusOK {
+			return
+		}
+
+		var chatResponse api.ChatResponse
+		if err := json.Unmarshal(w.b.Bytes(), &chatResponse); err != nil {
+			c.JSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		if schema := strictJSONSchema(req); schema != nil && !validateJSONSchema(schema, chatResponse.Message.Content) {
+			chatResponse = retryChatOnSchemaFailure(c, req, chatResponse, schema)
+			if !validateJSONSchema(schema, chatResponse.Message.Content) {
+				c.JSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, "model response did not match the requested json_schema"))
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, toChatCompletion(id, chatResponse))
+	}
+}
+
+// retryChatOnSchemaFailure re-prompts the model once, asking it to correct
+// output that failed strict json_schema validation. It re-invokes the route
+// handler directly via c.Handler() rather than c.Next(), which only runs the
+// remaining chain once per request.
+func retryChatOnSchemaFailure(c *gin.Context, req ChatCompletionRequest, failed api.ChatResponse, schema json.RawMessage) api.ChatResponse {
+	retry := fromChatRequest(req)
+	retry.Messages = append(retry.Messages,
+		api.Message{Role: failed.Message.Role, Content: failed.Message.Content},
+		api.Message{Role: "user", Content: "Your previous response was not valid JSON matching the required schema. Respond again with only JSON matching the schema."},
+	)
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(retry); err != nil {
+		return failed
+	}
+	c.Request.Body = io.NopCloser(&b)
+
+	w := &BodyWriter{ResponseWriter: c.Writer, b: new(bytes.Buffer)}
+	c.Writer = w
+
+	c.Handler()(c)
+	c.Writer = w.ResponseWriter
+
+	if w.Status() != http.StatusOK {
+		return failed
+	}
+
+	var retried api.ChatResponse
+	if err := json.Unmarshal(w.b.Bytes(), &retried); err != nil {
+		return failed
+	}
+
+	return retried
+}
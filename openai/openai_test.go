@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -245,6 +246,121 @@ func TestMiddleware(t *testing.T) {
 				}
 			},
 		},
+		{
+			Name:     "moderation handler (single input)",
+			Method:   http.MethodPost,
+			Path:     "/api/generate",
+			TestPath: "/api/generate",
+			Handler:  ModerationMiddleware,
+			Endpoint: func(c *gin.Context) {
+				c.JSON(http.StatusOK, api.GenerateResponse{
+					Response: `[{"hate":0.0,"hate/threatening":0.0,"harassment":0.0,"harassment/threatening":0.0,"self-harm":0.0,"self-harm/intent":0.0,"self-harm/instructions":0.0,"sexual":0.0,"sexual/minors":0.0,"violence":0.9,"violence/graphic":0.0}]`,
+				})
+			},
+			Setup: func(t *testing.T, req *http.Request) {
+				body := ModerationRequest{
+					Input: "I will hurt you",
+					Model: "test-guard-model",
+				}
+
+				bodyBytes, _ := json.Marshal(body)
+
+				req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+				req.Header.Set("Content-Type", "application/json")
+			},
+			Expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				var modResp Moderation
+				if err := json.NewDecoder(resp.Body).Decode(&modResp); err != nil {
+					t.Fatal(err)
+				}
+
+				if len(modResp.Results) != 1 {
+					t.Fatalf("expected 1 result, got %d", len(modResp.Results))
+				}
+
+				if !modResp.Results[0].Flagged {
+					t.Fatal("expected result to be flagged")
+				}
+
+				if !modResp.Results[0].Categories.Violence {
+					t.Fatal("expected violence category to be flagged")
+				}
+			},
+		},
+		{
+			Name:     "moderation handler (batch input)",
+			Method:   http.MethodPost,
+			Path:     "/api/generate",
+			TestPath: "/api/generate",
+			Handler:  ModerationMiddleware,
+			Endpoint: func(c *gin.Context) {
+				c.JSON(http.StatusOK, api.GenerateResponse{
+					Response: `[{"hate":0.0,"hate/threatening":0.0,"harassment":0.0,"harassment/threatening":0.0,"self-harm":0.0,"self-harm/intent":0.0,"self-harm/instructions":0.0,"sexual":0.0,"sexual/minors":0.0,"violence":0.0,"violence/graphic":0.0},{"hate":0.0,"hate/threatening":0.0,"harassment":0.0,"harassment/threatening":0.0,"self-harm":0.0,"self-harm/intent":0.0,"self-harm/instructions":0.0,"sexual":0.0,"sexual/minors":0.0,"violence":0.0,"violence/graphic":0.0}]`,
+				})
+			},
+			Setup: func(t *testing.T, req *http.Request) {
+				body := ModerationRequest{
+					Input: []string{"Hello", "World"},
+					Model: "test-guard-model",
+				}
+
+				bodyBytes, _ := json.Marshal(body)
+
+				req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+				req.Header.Set("Content-Type", "application/json")
+			},
+			Expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				var modResp Moderation
+				if err := json.NewDecoder(resp.Body).Decode(&modResp); err != nil {
+					t.Fatal(err)
+				}
+
+				if len(modResp.Results) != 2 {
+					t.Fatalf("expected 2 results, got %d", len(modResp.Results))
+				}
+
+				if modResp.Results[0].Flagged || modResp.Results[1].Flagged {
+					t.Fatal("expected neither result to be flagged")
+				}
+			},
+		},
+		{
+			Name:     "moderation handler (malformed model output)",
+			Method:   http.MethodPost,
+			Path:     "/api/generate",
+			TestPath: "/api/generate",
+			Handler:  ModerationMiddleware,
+			Endpoint: func(c *gin.Context) {
+				c.JSON(http.StatusOK, api.GenerateResponse{
+					Response: `not valid json`,
+				})
+			},
+			Setup: func(t *testing.T, req *http.Request) {
+				body := ModerationRequest{
+					Input: "Hello",
+					Model: "test-guard-model",
+				}
+
+				bodyBytes, _ := json.Marshal(body)
+
+				req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+				req.Header.Set("Content-Type", "application/json")
+			},
+			Expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				var modResp Moderation
+				if err := json.NewDecoder(resp.Body).Decode(&modResp); err != nil {
+					t.Fatal(err)
+				}
+
+				if len(modResp.Results) != 1 {
+					t.Fatalf("expected 1 result, got %d", len(modResp.Results))
+				}
+
+				if modResp.Results[0].Flagged {
+					t.Fatal("expected fallback result to be unflagged")
+				}
+			},
+		},
 	}
 
 	gin.SetMode(gin.TestMode)
@@ -270,3 +386,374 @@ func TestMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestChatMiddlewareStreaming(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	streamEndpoint := func(c *gin.Context) {
+		c.Writer.Header().Set("Content-Type", "application/x-ndjson")
+
+		lines := []api.ChatResponse{
+			{Model: "test-model", Message: api.Message{Role: "assistant", Content: "Hello"}},
+			{Model: "test-model", Message: api.Message{Role: "assistant", Content: "!"}},
+			{Model: "test-model", Done: true, DoneReason: "stop", PromptEvalCount: 5, EvalCount: 2},
+		}
+
+		for _, line := range lines {
+			b, _ := json.Marshal(line)
+			c.Writer.Write(b)
+			c.Writer.Write([]byte("\n"))
+		}
+	}
+
+	router := gin.New()
+	router.Use(ChatMiddleware())
+	router.POST("/api/chat", streamEndpoint)
+
+	body, _ := json.Marshal(ChatCompletionRequest{
+		Model:         "test-model",
+		Messages:      []Message{{Role: "user", Content: "Hello"}},
+		Stream:        true,
+		StreamOptions: &StreamOptions{IncludeUsage: true},
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/chat", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "text/event-stream", resp.Header().Get("Content-Type"))
+
+	// 2 content chunks + 1 finish_reason chunk (for the Done line) + 1 usage
+	// chunk + the [DONE] terminator.
+	frames := strings.Split(strings.TrimSpace(resp.Body.String()), "\n\n")
+	if len(frames) != 5 {
+		t.Fatalf("expected 5 SSE frames (2 content + finish_reason + usage + done), got %d: %q", len(frames), resp.Body.String())
+	}
+
+	if frames[len(frames)-1] != "data: [DONE]" {
+		t.Fatalf("expected terminating data: [DONE], got %q", frames[len(frames)-1])
+	}
+
+	var usageChunk ChatCompletionChunk
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(frames[len(frames)-2], "data: ")), &usageChunk); err != nil {
+		t.Fatal(err)
+	}
+
+	if usageChunk.Usage == nil || usageChunk.Usage.TotalTokens != 7 {
+		t.Fatalf("expected usage chunk with 7 total tokens, got %+v", usageChunk.Usage)
+	}
+
+	var finishChunk ChatCompletionChunk
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(frames[len(frames)-3], "data: ")), &finishChunk); err != nil {
+		t.Fatal(err)
+	}
+
+	if finishChunk.Choices[0].FinishReason == nil || *finishChunk.Choices[0].FinishReason != "stop" {
+		t.Fatalf("expected finish_reason stop, got %+v", finishChunk.Choices[0].FinishReason)
+	}
+
+	var firstChunk ChatCompletionChunk
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(frames[0], "data: ")), &firstChunk); err != nil {
+		t.Fatal(err)
+	}
+
+	if firstChunk.Object != "chat.completion.chunk" {
+		t.Fatalf("expected chat.completion.chunk, got %s", firstChunk.Object)
+	}
+
+	if firstChunk.Choices[0].Delta.Content != "Hello" {
+		t.Fatalf("expected Hello, got %s", firstChunk.Choices[0].Delta.Content)
+	}
+}
+
+func TestChatMiddlewareJSONSchema(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	schema := json.RawMessage(`{"type":"object","properties":{"answer":{"type":"string"}},"required":["answer"]}`)
+	responseFormat := &ResponseFormat{
+		Type: "json_schema",
+		JSONSchema: &JSONSchema{
+			Name:   "answer",
+			Schema: schema,
+			Strict: true,
+		},
+	}
+
+	newRequest := func(t *testing.T) *http.Request {
+		body, _ := json.Marshal(ChatCompletionRequest{
+			Model:          "test-model",
+			Messages:       []Message{{Role: "user", Content: "2+2?"}},
+			ResponseFormat: responseFormat,
+		})
+		req, _ := http.NewRequest(http.MethodPost, "/api/chat", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	t.Run("request forwards the schema as format", func(t *testing.T) {
+		var gotFormat json.RawMessage
+
+		router := gin.New()
+		router.Use(ChatMiddleware())
+		router.POST("/api/chat", func(c *gin.Context) {
+			var chatReq api.ChatRequest
+			if err := c.ShouldBindJSON(&chatReq); err != nil {
+				t.Fatal(err)
+			}
+			gotFormat = chatReq.Format
+
+			c.JSON(http.StatusOK, api.ChatResponse{
+				Message: api.Message{Role: "assistant", Content: `{"answer":"4"}`},
+				Done:    true,
+			})
+		})
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, newRequest(t))
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, string(schema), string(gotFormat))
+	})
+
+	t.Run("invalid output still failing after one retry returns an error", func(t *testing.T) {
+		calls := 0
+		router := gin.New()
+		router.Use(ChatMiddleware())
+		router.POST("/api/chat", func(c *gin.Context) {
+			calls++
+			c.JSON(http.StatusOK, api.ChatResponse{
+				Message: api.Message{Role: "assistant", Content: "not json"},
+				Done:    true,
+			})
+		})
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, newRequest(t))
+
+		if calls != 2 {
+			t.Fatalf("expected exactly one retry (2 calls), got %d", calls)
+		}
+
+		assert.Equal(t, http.StatusInternalServerError, resp.Code)
+
+		var errResp ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+			t.Fatal(err)
+		}
+
+		if errResp.Error.Type != "api_error" {
+			t.Fatalf("expected api_error, got %s", errResp.Error.Type)
+		}
+	})
+
+	t.Run("invalid output corrected on retry succeeds", func(t *testing.T) {
+		calls := 0
+		router := gin.New()
+		router.Use(ChatMiddleware())
+		router.POST("/api/chat", func(c *gin.Context) {
+			calls++
+			content := "not json"
+			if calls == 2 {
+				content = `{"answer":"4"}`
+			}
+			c.JSON(http.StatusOK, api.ChatResponse{
+				Message: api.Message{Role: "assistant", Content: content},
+				Done:    true,
+			})
+		})
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, newRequest(t))
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var chatResp ChatCompletion
+		if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+			t.Fatal(err)
+		}
+
+		if chatResp.Choices[0].Message.Content != `{"answer":"4"}` {
+			t.Fatalf("expected corrected content, got %s", chatResp.Choices[0].Message.Content)
+		}
+	})
+}
+
+func TestWithDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	slowEndpoint := func(c *gin.Context) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+		case <-c.Request.Context().Done():
+		}
+	}
+
+	router := gin.New()
+	router.Use(WithDeadline(20 * time.Millisecond))
+	router.POST("/slow", slowEndpoint)
+
+	req, _ := http.NewRequest(http.MethodPost, "/slow", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusRequestTimeout, resp.Code)
+
+	var errResp ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		t.Fatal(err)
+	}
+
+	if errResp.Error.Type != "timeout" {
+		t.Fatalf("expected type timeout, got %s", errResp.Error.Type)
+	}
+
+	if errResp.Error.Code == nil || *errResp.Error.Code != "request_timeout" {
+		t.Fatalf("expected code request_timeout, got %v", errResp.Error.Code)
+	}
+
+	if strings.Contains(resp.Body.String(), "data: ") {
+		t.Fatal("expected no SSE frames in a non-streaming timeout response")
+	}
+}
+
+func TestWithDeadlineStreamingFlushesDone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	slowStreamEndpoint := func(c *gin.Context) {
+		c.Writer.Header().Set("Content-Type", "application/x-ndjson")
+		b, _ := json.Marshal(api.ChatResponse{Model: "test-model", Message: api.Message{Role: "assistant", Content: "partial"}})
+		c.Writer.Write(b)
+		c.Writer.Write([]byte("\n"))
+
+		<-c.Request.Context().Done()
+	}
+
+	router := gin.New()
+	router.Use(ChatMiddleware(), WithDeadline(20*time.Millisecond))
+	router.POST("/api/chat", slowStreamEndpoint)
+
+	body, _ := json.Marshal(ChatCompletionRequest{
+		Model:    "test-model",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+		Stream:   true,
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/chat", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	if !strings.HasSuffix(strings.TrimSpace(resp.Body.String()), "data: [DONE]") {
+		t.Fatalf("expected stream to end with data: [DONE], got %q", resp.Body.String())
+	}
+}
+
+func TestFineTuningMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	createEndpoint := func(c *gin.Context) {
+		c.Writer.Header().Set("Content-Type", "application/x-ndjson")
+		c.String(http.StatusOK, `{"status":"creating model layer"}`+"\n"+`{"status":"success"}`+"\n")
+	}
+
+	router := gin.New()
+	router.POST("/v1/fine_tuning/jobs", CreateFineTuningJobMiddleware(), createEndpoint)
+	router.GET("/v1/fine_tuning/jobs", ListFineTuningJobsMiddleware())
+	router.GET("/v1/fine_tuning/jobs/:id", RetrieveFineTuningJobMiddleware())
+	router.POST("/v1/fine_tuning/jobs/:id/cancel", CancelFineTuningJobMiddleware())
+	router.GET("/v1/fine_tuning/jobs/:id/events", ListFineTuningJobEventsMiddleware())
+
+	body, _ := json.Marshal(FineTuningJobRequest{
+		Model:        "test-model",
+		TrainingFile: "file-abc123",
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/fine_tuning/jobs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var job FineTuningJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Object != "fine_tuning.job" {
+		t.Fatalf("expected fine_tuning.job, got %s", job.Object)
+	}
+
+	if job.Status != "succeeded" {
+		t.Fatalf("expected succeeded, got %s", job.Status)
+	}
+
+	if job.FineTunedModel == nil || *job.FineTunedModel != "test-model:"+job.Id {
+		t.Fatalf("expected fine_tuned_model to be set, got %v", job.FineTunedModel)
+	}
+
+	listReq, _ := http.NewRequest(http.MethodGet, "/v1/fine_tuning/jobs", nil)
+	listResp := httptest.NewRecorder()
+	router.ServeHTTP(listResp, listReq)
+
+	var list FineTuningJobList
+	if err := json.NewDecoder(listResp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list.Data) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(list.Data))
+	}
+
+	eventsReq, _ := http.NewRequest(http.MethodGet, "/v1/fine_tuning/jobs/"+job.Id+"/events", nil)
+	eventsResp := httptest.NewRecorder()
+	router.ServeHTTP(eventsResp, eventsReq)
+
+	var events FineTuningJobEventList
+	if err := json.NewDecoder(eventsResp.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events.Data) == 0 {
+		t.Fatal("expected at least one fine-tuning job event")
+	}
+
+	retrieveReq, _ := http.NewRequest(http.MethodGet, "/v1/fine_tuning/jobs/"+job.Id, nil)
+	retrieveResp := httptest.NewRecorder()
+	router.ServeHTTP(retrieveResp, retrieveReq)
+
+	var retrieved FineTuningJob
+	if err := json.NewDecoder(retrieveResp.Body).Decode(&retrieved); err != nil {
+		t.Fatal(err)
+	}
+
+	if retrieved.Id != job.Id {
+		t.Fatalf("expected %s, got %s", job.Id, retrieved.Id)
+	}
+
+	// Force the job back to "running" to exercise the cancel path; this
+	// also regression-tests against the self-deadlock in
+	// CancelFineTuningJobMiddleware (it must not re-lock fineTuningJobs
+	// while already holding it).
+	fineTuningJobs.Lock()
+	fineTuningJobs.jobs[job.Id].Status = "running"
+	fineTuningJobs.Unlock()
+
+	cancelReq, _ := http.NewRequest(http.MethodPost, "/v1/fine_tuning/jobs/"+job.Id+"/cancel", nil)
+	cancelResp := httptest.NewRecorder()
+	router.ServeHTTP(cancelResp, cancelReq)
+	assert.Equal(t, http.StatusOK, cancelResp.Code)
+
+	var cancelled FineTuningJob
+	if err := json.NewDecoder(cancelResp.Body).Decode(&cancelled); err != nil {
+		t.Fatal(err)
+	}
+
+	if cancelled.Status != "cancelled" {
+		t.Fatalf("expected cancelled, got %s", cancelled.Status)
+	}
+}